@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// backendStatus is the JSON shape returned by the /backends admin endpoint.
+type backendStatus struct {
+	Address     string `json:"address"`
+	Weight      int    `json:"weight"`
+	Healthy     bool   `json:"healthy"`
+	ActiveConns int    `json:"activeConns"`
+}
+
+// newAdminMux builds the admin HTTP handler exposing /healthz (overall pool
+// health, for load-balancer/orchestrator probes), /backends (per-backend
+// status, for operators), /limits (connection and traffic counters), and
+// /metrics (Prometheus scrape endpoint). It reads current on every request,
+// so a hot config reload is reflected immediately without restarting the
+// admin server.
+func newAdminMux(current *atomic.Pointer[Runtime], metrics *Metrics) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		for _, b := range current.Load().backends {
+			if b.Healthy() {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte("ok\n"))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("no healthy backends\n"))
+	})
+
+	mux.HandleFunc("/backends", func(w http.ResponseWriter, r *http.Request) {
+		backends := current.Load().backends
+		statuses := make([]backendStatus, len(backends))
+		for i, b := range backends {
+			statuses[i] = backendStatus{
+				Address:     b.Address,
+				Weight:      b.Weight,
+				Healthy:     b.Healthy(),
+				ActiveConns: b.ActiveConns(),
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statuses)
+	})
+
+	mux.HandleFunc("/limits", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(current.Load().limits.Stats())
+	})
+
+	mux.Handle("/metrics", metrics.Handler())
+
+	return mux
+}
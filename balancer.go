@@ -0,0 +1,376 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Backend schemes accepted by the per-backend "scheme" config field.
+const (
+	BackendSchemeTCP = "tcp"
+	BackendSchemeTLS = "tls"
+)
+
+// Backend represents a single upstream server the proxy can forward
+// connections to, along with the bookkeeping a Balancer needs to make
+// decisions about it.
+type Backend struct {
+	Address           string
+	Weight            int
+	Scheme            string
+	SendProxyProtocol string
+
+	tlsConfig *tls.Config
+
+	mu          sync.Mutex
+	activeConns int
+
+	healthy      atomic.Bool
+	failures     atomic.Int32
+	ejectedUntil atomic.Int64
+
+	failureThreshold int
+	cooldownSeconds  int
+}
+
+// NewBackend creates a Backend from its config entry, starting out healthy.
+// A scheme of "tls" builds the *tls.Config used to re-encrypt connections
+// to this backend.
+func NewBackend(cfg BackendConfig) (*Backend, error) {
+	b := &Backend{
+		Address:           cfg.Address,
+		Weight:            cfg.Weight,
+		Scheme:            cfg.Scheme,
+		SendProxyProtocol: cfg.SendProxyProtocol,
+		failureThreshold:  DefaultHealthCheck.FailureThreshold,
+		cooldownSeconds:   DefaultHealthCheck.CooldownSeconds,
+	}
+	b.healthy.Store(true)
+
+	if cfg.Scheme == BackendSchemeTLS {
+		tlsConfig, err := backendTLSConfig(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("backend %s: %w", cfg.Address, err)
+		}
+		b.tlsConfig = tlsConfig
+	}
+
+	return b, nil
+}
+
+// configureHealthCheck applies the failure threshold and cool-down period
+// that RecordFailure should use for this backend.
+func (b *Backend) configureHealthCheck(cfg HealthCheckConfig) {
+	b.failureThreshold = cfg.FailureThreshold
+	b.cooldownSeconds = cfg.CooldownSeconds
+}
+
+// RecordFailure registers a dial or proxy failure against this backend. Once
+// failures reach the configured threshold, the backend is ejected from
+// rotation for its cool-down period (a simple circuit breaker).
+func (b *Backend) RecordFailure() {
+	n := b.failures.Add(1)
+	if int(n) >= b.failureThreshold {
+		b.ejectedUntil.Store(time.Now().Add(time.Duration(b.cooldownSeconds) * time.Second).UnixNano())
+		b.healthy.Store(false)
+	}
+}
+
+// RecordSuccess clears any accumulated failures and marks the backend
+// healthy again.
+func (b *Backend) RecordSuccess() {
+	b.failures.Store(0)
+	b.healthy.Store(true)
+}
+
+// Healthy reports whether the backend should currently receive traffic. A
+// backend ejected by RecordFailure becomes eligible again once its
+// cool-down period elapses, so a fresh attempt can confirm it has
+// recovered.
+func (b *Backend) Healthy() bool {
+	if b.healthy.Load() {
+		return true
+	}
+	until := b.ejectedUntil.Load()
+	return until != 0 && time.Now().UnixNano() >= until
+}
+
+// addConns adjusts the active connection count for this backend by delta.
+func (b *Backend) addConns(delta int) {
+	b.mu.Lock()
+	b.activeConns += delta
+	b.mu.Unlock()
+}
+
+// ActiveConns returns the number of connections currently being proxied to
+// this backend.
+func (b *Backend) ActiveConns() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.activeConns
+}
+
+// healthyOrAll returns the subset of backends currently considered healthy,
+// or the full slice if none are, so that a total outage doesn't stop the
+// proxy from at least attempting to serve traffic.
+func healthyOrAll(backends []*Backend) []*Backend {
+	healthy := make([]*Backend, 0, len(backends))
+	for _, b := range backends {
+		if b.Healthy() {
+			healthy = append(healthy, b)
+		}
+	}
+	if len(healthy) == 0 {
+		return backends
+	}
+	return healthy
+}
+
+// Balancer selects a backend for an incoming connection and is notified
+// when the proxy is done with it, so that strategies which track
+// per-backend state (e.g. least-connections) stay accurate.
+type Balancer interface {
+	// Pick returns the backend that should handle conn.
+	Pick(conn net.Conn) *Backend
+	// Release is called once the proxy has finished using the backend
+	// returned by Pick, whether the connection succeeded or failed.
+	Release(backend *Backend)
+}
+
+// Strategy names accepted by the "strategy" config field.
+const (
+	StrategyRandom             = "random"
+	StrategyWeightedRoundRobin = "weighted-round-robin"
+	StrategyLeastConnections   = "least-connections"
+	StrategyConsistentHash     = "consistent-hash"
+)
+
+// NewBalancer constructs the Balancer for the given strategy name. An empty
+// strategy defaults to StrategyRandom, preserving the proxy's original
+// behavior.
+func NewBalancer(strategy string, backends []*Backend) (Balancer, error) {
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("no backends configured")
+	}
+
+	switch strategy {
+	case "", StrategyRandom:
+		return newRandomBalancer(backends), nil
+	case StrategyWeightedRoundRobin:
+		return newWeightedRoundRobinBalancer(backends), nil
+	case StrategyLeastConnections:
+		return newLeastConnectionsBalancer(backends), nil
+	case StrategyConsistentHash:
+		return newConsistentHashBalancer(backends), nil
+	default:
+		return nil, fmt.Errorf("unknown load-balancing strategy %q", strategy)
+	}
+}
+
+// randomBalancer picks a backend uniformly at random. This is the proxy's
+// original selection behavior.
+type randomBalancer struct {
+	backends []*Backend
+	mu       sync.Mutex
+	rng      *rand.Rand
+}
+
+func newRandomBalancer(backends []*Backend) *randomBalancer {
+	return &randomBalancer{
+		backends: backends,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (b *randomBalancer) Pick(conn net.Conn) *Backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	candidates := healthyOrAll(b.backends)
+	return candidates[b.rng.Intn(len(candidates))]
+}
+
+func (b *randomBalancer) Release(backend *Backend) {}
+
+// weightedRoundRobinBalancer cycles through backends in proportion to their
+// configured weight, using the smooth weighted round-robin algorithm (as
+// used by nginx and LVS): each pick adds a backend's weight to its current
+// value, then selects and penalizes the backend with the highest current
+// value by the total weight.
+type weightedRoundRobinBalancer struct {
+	mu       sync.Mutex
+	backends []*Backend
+	current  []int
+	total    int
+}
+
+func newWeightedRoundRobinBalancer(backends []*Backend) *weightedRoundRobinBalancer {
+	total := 0
+	for _, be := range backends {
+		w := be.Weight
+		if w <= 0 {
+			w = 1
+		}
+		total += w
+	}
+	return &weightedRoundRobinBalancer{
+		backends: backends,
+		current:  make([]int, len(backends)),
+		total:    total,
+	}
+}
+
+func (b *weightedRoundRobinBalancer) Pick(conn net.Conn) *Backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	anyHealthy := false
+	for _, be := range b.backends {
+		if be.Healthy() {
+			anyHealthy = true
+			break
+		}
+	}
+
+	best := -1
+	activeTotal := 0
+	for i, be := range b.backends {
+		if anyHealthy && !be.Healthy() {
+			// Don't let an excluded backend accrue current: otherwise it
+			// wins every pick for a while once it recovers, paying off a
+			// backlog built up while it was down instead of being smoothly
+			// folded back into rotation.
+			b.current[i] = 0
+			continue
+		}
+		w := be.Weight
+		if w <= 0 {
+			w = 1
+		}
+		activeTotal += w
+		b.current[i] += w
+		if best == -1 || b.current[i] > b.current[best] {
+			best = i
+		}
+	}
+	// Penalize by the total weight of backends actually in rotation right
+	// now, not the static configured total: otherwise a pick made while
+	// some backends are excluded still drags current down by their
+	// weight, so the survivors' current drifts further negative the
+	// longer the outage lasts instead of cycling in a steady band.
+	b.current[best] -= activeTotal
+	return b.backends[best]
+}
+
+func (b *weightedRoundRobinBalancer) Release(backend *Backend) {}
+
+// leastConnectionsBalancer routes each connection to the backend with the
+// fewest active proxy goroutines, re-evaluated on every pick. Backends tied
+// for fewest are broken at random, so light or bursty traffic (where
+// connections routinely finish before the next one arrives, leaving every
+// backend tied at zero) still spreads across the pool instead of always
+// landing on the first configured backend.
+type leastConnectionsBalancer struct {
+	backends []*Backend
+	mu       sync.Mutex
+	rng      *rand.Rand
+}
+
+func newLeastConnectionsBalancer(backends []*Backend) *leastConnectionsBalancer {
+	return &leastConnectionsBalancer{
+		backends: backends,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (b *leastConnectionsBalancer) Pick(conn net.Conn) *Backend {
+	candidates := healthyOrAll(b.backends)
+
+	min := candidates[0].ActiveConns()
+	for _, be := range candidates[1:] {
+		if n := be.ActiveConns(); n < min {
+			min = n
+		}
+	}
+
+	tied := make([]*Backend, 0, len(candidates))
+	for _, be := range candidates {
+		if be.ActiveConns() == min {
+			tied = append(tied, be)
+		}
+	}
+
+	b.mu.Lock()
+	best := tied[b.rng.Intn(len(tied))]
+	b.mu.Unlock()
+
+	best.addConns(1)
+	return best
+}
+
+func (b *leastConnectionsBalancer) Release(backend *Backend) {
+	backend.addConns(-1)
+}
+
+// consistentHashBalancer assigns each client IP to a backend using
+// consistent hashing over a ring of virtual nodes, so repeated connections
+// from the same client land on the same backend for session affinity.
+type consistentHashBalancer struct {
+	backends map[uint32]*Backend
+	ring     []uint32
+}
+
+const hashBalancerReplicas = 100
+
+func newConsistentHashBalancer(backends []*Backend) *consistentHashBalancer {
+	b := &consistentHashBalancer{
+		backends: make(map[uint32]*Backend),
+	}
+	for _, be := range backends {
+		for i := 0; i < hashBalancerReplicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s#%d", be.Address, i)))
+			b.backends[h] = be
+			b.ring = append(b.ring, h)
+		}
+	}
+	sort.Slice(b.ring, func(i, j int) bool { return b.ring[i] < b.ring[j] })
+	return b
+}
+
+func (b *consistentHashBalancer) Pick(conn net.Conn) *Backend {
+	key := clientIP(conn)
+	h := crc32.ChecksumIEEE([]byte(key))
+
+	idx := sort.Search(len(b.ring), func(i int) bool { return b.ring[i] >= h })
+	if idx == len(b.ring) {
+		idx = 0
+	}
+
+	// Walk forward around the ring for a healthy owner of this key,
+	// falling back to the original pick if every backend is down.
+	for i := 0; i < len(b.ring); i++ {
+		pos := (idx + i) % len(b.ring)
+		if be := b.backends[b.ring[pos]]; be.Healthy() {
+			return be
+		}
+	}
+	return b.backends[b.ring[idx]]
+}
+
+func (b *consistentHashBalancer) Release(backend *Backend) {}
+
+// clientIP extracts the IP portion of conn's remote address, falling back
+// to the full address string if it cannot be parsed.
+func clientIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
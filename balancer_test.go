@@ -0,0 +1,101 @@
+package main
+
+import "testing"
+
+func testBackend(address string, weight int) *Backend {
+	b := &Backend{Address: address, Weight: weight}
+	b.healthy.Store(true)
+	return b
+}
+
+func TestWeightedRoundRobinBalancer_Distribution(t *testing.T) {
+	backends := []*Backend{
+		testBackend("a", 3),
+		testBackend("b", 1),
+		testBackend("c", 1),
+	}
+	b := newWeightedRoundRobinBalancer(backends)
+
+	counts := map[string]int{}
+	const picks = 50 // 10 full cycles of total weight 5
+	for i := 0; i < picks; i++ {
+		counts[b.Pick(nil).Address]++
+	}
+
+	want := map[string]int{"a": 30, "b": 10, "c": 10}
+	for addr, w := range want {
+		if counts[addr] != w {
+			t.Errorf("backend %s: got %d picks over %d, want %d", addr, counts[addr], picks, w)
+		}
+	}
+}
+
+func TestWeightedRoundRobinBalancer_NonPositiveWeightDefaultsToOne(t *testing.T) {
+	backends := []*Backend{testBackend("a", 0), testBackend("b", -5)}
+	b := newWeightedRoundRobinBalancer(backends)
+
+	if b.total != 2 {
+		t.Fatalf("total = %d, want 2 (both backends normalized to weight 1)", b.total)
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 10; i++ {
+		counts[b.Pick(nil).Address]++
+	}
+	if counts["a"] != 5 || counts["b"] != 5 {
+		t.Errorf("counts = %v, want an even 5/5 split", counts)
+	}
+}
+
+// TestWeightedRoundRobinBalancer_RecoveredBackendDoesNotThunderingHerd
+// guards against a backend that was down for a while winning every pick
+// once it recovers to pay off a backlog of accrued `current`.
+func TestWeightedRoundRobinBalancer_RecoveredBackendDoesNotThunderingHerd(t *testing.T) {
+	flaky := testBackend("flaky", 1)
+	steady := testBackend("steady", 1)
+	b := newWeightedRoundRobinBalancer([]*Backend{flaky, steady})
+
+	flaky.healthy.Store(false)
+	const downPicks = 20
+	for i := 0; i < downPicks; i++ {
+		if got := b.Pick(nil); got.Address != "steady" {
+			t.Fatalf("pick %d while flaky is down: got %s, want steady", i, got.Address)
+		}
+	}
+
+	flaky.healthy.Store(true)
+
+	// With current reset to 0 on every down pick, flaky comes back on
+	// equal footing with steady instead of winning downPicks/total=20
+	// picks in a row.
+	counts := map[string]int{}
+	const recoveryPicks = 10
+	for i := 0; i < recoveryPicks; i++ {
+		counts[b.Pick(nil).Address]++
+	}
+	if counts["flaky"] != 5 || counts["steady"] != 5 {
+		t.Errorf("picks after recovery = %v, want an even 5/5 split, not a backlog-fueled streak", counts)
+	}
+}
+
+// TestLeastConnectionsBalancer_TiesSpreadAcrossBackends guards against ties
+// always resolving to the first configured backend, which under light or
+// bursty traffic (every backend tied at zero between requests) makes
+// picks land on the same backend every time instead of being distributed.
+func TestLeastConnectionsBalancer_TiesSpreadAcrossBackends(t *testing.T) {
+	backends := []*Backend{testBackend("a", 1), testBackend("b", 1), testBackend("c", 1)}
+	b := newLeastConnectionsBalancer(backends)
+
+	counts := map[string]int{}
+	for i := 0; i < 60; i++ {
+		picked := b.Pick(nil)
+		counts[picked.Address]++
+		b.Release(picked) // simulate the connection finishing immediately, so every pick is a fresh three-way tie
+	}
+
+	for _, addr := range []string{"a", "b", "c"} {
+		if counts[addr] == 0 {
+			t.Errorf("backend %s was never picked across 60 tied picks: %v", addr, counts)
+		}
+	}
+}
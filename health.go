@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HealthCheckConfig controls how the HealthChecker actively probes
+// backends and how passive failures (reported by proxy itself) eject a
+// backend from rotation.
+type HealthCheckConfig struct {
+	IntervalSeconds  int    `json:"intervalSeconds"`
+	TimeoutSeconds   int    `json:"timeoutSeconds"`
+	HealthPath       string `json:"healthPath"`
+	FailureThreshold int    `json:"failureThreshold"`
+	CooldownSeconds  int    `json:"cooldownSeconds"`
+}
+
+// DefaultHealthCheck is used for any field left unset in the config file.
+var DefaultHealthCheck = HealthCheckConfig{
+	IntervalSeconds:  5,
+	TimeoutSeconds:   2,
+	FailureThreshold: 3,
+	CooldownSeconds:  10,
+}
+
+// withDefaults fills in zero-valued fields of cfg from DefaultHealthCheck.
+func (cfg HealthCheckConfig) withDefaults() HealthCheckConfig {
+	if cfg.IntervalSeconds <= 0 {
+		cfg.IntervalSeconds = DefaultHealthCheck.IntervalSeconds
+	}
+	if cfg.TimeoutSeconds <= 0 {
+		cfg.TimeoutSeconds = DefaultHealthCheck.TimeoutSeconds
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = DefaultHealthCheck.FailureThreshold
+	}
+	if cfg.CooldownSeconds <= 0 {
+		cfg.CooldownSeconds = DefaultHealthCheck.CooldownSeconds
+	}
+	return cfg
+}
+
+// HealthChecker actively probes a pool of backends on a fixed interval,
+// using a TCP connect or, when HealthPath is set, an HTTP GET against that
+// path. Results feed the same Backend.RecordFailure/RecordSuccess used for
+// the proxy's passive checks, so active and passive signals share one
+// circuit breaker per backend.
+type HealthChecker struct {
+	cfg      HealthCheckConfig
+	backends []*Backend
+	client   *http.Client
+	metrics  *Metrics
+}
+
+// NewHealthChecker builds a HealthChecker for backends using cfg, applying
+// defaults for any unset fields. Every check result is also reported to
+// metrics as the lb_backend_up gauge.
+func NewHealthChecker(cfg HealthCheckConfig, backends []*Backend, metrics *Metrics) *HealthChecker {
+	cfg = cfg.withDefaults()
+	for _, b := range backends {
+		b.configureHealthCheck(cfg)
+	}
+	return &HealthChecker{
+		cfg:      cfg,
+		backends: backends,
+		client:   &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second},
+		metrics:  metrics,
+	}
+}
+
+// Run probes every backend immediately and then on every tick of the
+// configured interval, until ctx is canceled. Call it in its own goroutine.
+func (hc *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(hc.cfg.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	hc.checkAll()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hc.checkAll()
+		}
+	}
+}
+
+func (hc *HealthChecker) checkAll() {
+	for _, b := range hc.backends {
+		go hc.check(b)
+	}
+}
+
+func (hc *HealthChecker) check(b *Backend) {
+	defer func() { hc.metrics.SetBackendUp(b.Address, b.Healthy()) }()
+
+	if hc.cfg.HealthPath != "" {
+		scheme := "http"
+		client := hc.client
+		if b.Scheme == BackendSchemeTLS {
+			// Re-encrypt the health check the same way the proxy
+			// re-encrypts proxied connections to this backend, using its
+			// configured tlsConfig, so a TLS backend isn't ejected for
+			// refusing a plaintext probe it was never going to accept.
+			scheme = "https"
+			client = &http.Client{
+				Timeout:   hc.client.Timeout,
+				Transport: &http.Transport{TLSClientConfig: b.tlsConfig},
+			}
+		}
+
+		resp, err := client.Get(fmt.Sprintf("%s://%s%s", scheme, b.Address, hc.cfg.HealthPath))
+		if err != nil {
+			b.RecordFailure()
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			b.RecordFailure()
+			return
+		}
+		b.RecordSuccess()
+		return
+	}
+
+	conn, err := net.DialTimeout("tcp", b.Address, time.Duration(hc.cfg.TimeoutSeconds)*time.Second)
+	if err != nil {
+		b.RecordFailure()
+		return
+	}
+	conn.Close()
+	b.RecordSuccess()
+}
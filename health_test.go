@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBackend_CircuitBreaker_EjectsAfterFailureThreshold(t *testing.T) {
+	b := &Backend{Address: "test", failureThreshold: 2, cooldownSeconds: 10}
+	b.healthy.Store(true)
+
+	b.RecordFailure()
+	if !b.Healthy() {
+		t.Fatal("backend ejected after one failure, want it to stay healthy below the threshold")
+	}
+
+	b.RecordFailure()
+	if b.Healthy() {
+		t.Fatal("backend still healthy after reaching failureThreshold, want it ejected")
+	}
+}
+
+func TestBackend_CircuitBreaker_RecoversOnceCooldownElapses(t *testing.T) {
+	// A negative cooldown puts ejectedUntil in the past the instant it's
+	// set, letting the test assert the recovery path without sleeping.
+	b := &Backend{Address: "test", failureThreshold: 1, cooldownSeconds: -1}
+	b.healthy.Store(true)
+
+	b.RecordFailure()
+	if !b.Healthy() {
+		t.Fatal("backend stayed ejected past its cooldown, want it eligible again")
+	}
+}
+
+func TestBackend_RecordSuccess_ResetsFailureCount(t *testing.T) {
+	b := &Backend{Address: "test", failureThreshold: 2, cooldownSeconds: 10}
+	b.healthy.Store(true)
+
+	b.RecordFailure() // 1 of 2
+	b.RecordSuccess() // should zero the count, not just flip healthy back on
+	b.RecordFailure() // back to 1 of 2
+
+	if !b.Healthy() {
+		t.Fatal("backend ejected after a single failure following RecordSuccess, want the failure count reset")
+	}
+}
+
+func TestHealthChecker_TCPCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	backend, err := NewBackend(BackendConfig{Address: ln.Addr().String()})
+	if err != nil {
+		t.Fatalf("NewBackend: %v", err)
+	}
+	hc := NewHealthChecker(HealthCheckConfig{FailureThreshold: 1}, []*Backend{backend}, NewMetrics())
+
+	hc.check(backend)
+	if !backend.Healthy() {
+		t.Fatal("backend with a reachable port reported unhealthy")
+	}
+
+	ln.Close()
+	hc.check(backend)
+	if backend.Healthy() {
+		t.Fatal("backend with a closed port reported healthy")
+	}
+}
+
+func TestHealthChecker_HTTPCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		handlerCode int
+		wantHealthy bool
+	}{
+		{name: "200 OK is healthy", handlerCode: http.StatusOK, wantHealthy: true},
+		{name: "500 is unhealthy", handlerCode: http.StatusInternalServerError, wantHealthy: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.handlerCode)
+			}))
+			defer server.Close()
+
+			backend, err := NewBackend(BackendConfig{Address: server.Listener.Addr().String()})
+			if err != nil {
+				t.Fatalf("NewBackend: %v", err)
+			}
+			hc := NewHealthChecker(HealthCheckConfig{HealthPath: "/healthz", FailureThreshold: 1}, []*Backend{backend}, NewMetrics())
+
+			hc.check(backend)
+			if backend.Healthy() != tt.wantHealthy {
+				t.Errorf("backend.Healthy() = %v, want %v", backend.Healthy(), tt.wantHealthy)
+			}
+		})
+	}
+}
+
+func TestHealthChecker_HTTPCheck_TLSBackendUsesHTTPS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	backend, err := NewBackend(BackendConfig{Address: server.Listener.Addr().String(), Scheme: BackendSchemeTLS})
+	if err != nil {
+		t.Fatalf("NewBackend: %v", err)
+	}
+	// The test server uses a self-signed cert; skip verification the same
+	// way a real deployment would via caFile, just without one here.
+	backend.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+
+	hc := NewHealthChecker(HealthCheckConfig{HealthPath: "/healthz", FailureThreshold: 1}, []*Backend{backend}, NewMetrics())
+
+	hc.check(backend)
+	if !backend.Healthy() {
+		t.Fatal("TLS backend reported unhealthy, want the checker to probe it over https")
+	}
+}
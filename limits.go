@@ -0,0 +1,177 @@
+package main
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// LimitsConfig configures connection caps, the accept rate limit, and
+// per-connection bandwidth caps enforced by the Limits subsystem.
+type LimitsConfig struct {
+	MaxGlobalConnections int     `json:"maxGlobalConnections"`
+	MaxConnectionsPerIP  int     `json:"maxConnectionsPerIP"`
+	AcceptRatePerSecond  float64 `json:"acceptRatePerSecond"`
+	AcceptBurst          int     `json:"acceptBurst"`
+	MaxBytesPerSecondIn  int64   `json:"maxBytesPerSecondIn"`
+	MaxBytesPerSecondOut int64   `json:"maxBytesPerSecondOut"`
+}
+
+// Limits enforces a global and per-client-IP concurrent-connection cap and
+// an accept-rate token bucket, and tracks the traffic counters surfaced
+// through the admin endpoint. A zero-value LimitsConfig field disables that
+// particular limit.
+type Limits struct {
+	cfg LimitsConfig
+
+	globalSem chan struct{}
+	bucket    *tokenBucket
+
+	mu    sync.Mutex
+	perIP map[string]int
+
+	activeConns   atomic.Int64
+	rejectedConns atomic.Int64
+	bytesIn       atomic.Int64
+	bytesOut      atomic.Int64
+}
+
+// NewLimits builds a Limits enforcer from cfg.
+func NewLimits(cfg LimitsConfig) *Limits {
+	l := &Limits{cfg: cfg, perIP: make(map[string]int)}
+
+	if cfg.MaxGlobalConnections > 0 {
+		l.globalSem = make(chan struct{}, cfg.MaxGlobalConnections)
+	}
+	if cfg.AcceptRatePerSecond > 0 {
+		burst := cfg.AcceptBurst
+		if burst <= 0 {
+			burst = 1
+		}
+		l.bucket = newTokenBucket(cfg.AcceptRatePerSecond, burst)
+	}
+
+	return l
+}
+
+// Admit reports whether a newly accepted connection should be let through.
+// It consumes an accept-rate token and a global/per-IP connection slot; a
+// rejection is counted and no slot is held. Callers that get true back must
+// call Release once the connection is done.
+func (l *Limits) Admit(conn net.Conn) bool {
+	if l.bucket != nil && !l.bucket.Allow() {
+		l.rejectedConns.Add(1)
+		return false
+	}
+
+	if l.globalSem != nil {
+		select {
+		case l.globalSem <- struct{}{}:
+		default:
+			l.rejectedConns.Add(1)
+			return false
+		}
+	}
+
+	ip := clientIP(conn)
+	if l.cfg.MaxConnectionsPerIP > 0 {
+		l.mu.Lock()
+		if l.perIP[ip] >= l.cfg.MaxConnectionsPerIP {
+			l.mu.Unlock()
+			if l.globalSem != nil {
+				<-l.globalSem
+			}
+			l.rejectedConns.Add(1)
+			return false
+		}
+		l.perIP[ip]++
+		l.mu.Unlock()
+	}
+
+	l.activeConns.Add(1)
+	return true
+}
+
+// Release frees the global/per-IP slot acquired by a successful Admit.
+func (l *Limits) Release(conn net.Conn) {
+	l.activeConns.Add(-1)
+
+	ip := clientIP(conn)
+	if l.cfg.MaxConnectionsPerIP > 0 {
+		l.mu.Lock()
+		if l.perIP[ip] > 0 {
+			l.perIP[ip]--
+			if l.perIP[ip] == 0 {
+				delete(l.perIP, ip)
+			}
+		}
+		l.mu.Unlock()
+	}
+
+	if l.globalSem != nil {
+		<-l.globalSem
+	}
+}
+
+// LimitsStats is the point-in-time snapshot returned by the /limits admin
+// endpoint.
+type LimitsStats struct {
+	ActiveConns   int64 `json:"activeConns"`
+	RejectedConns int64 `json:"rejectedConns"`
+	BytesIn       int64 `json:"bytesIn"`
+	BytesOut      int64 `json:"bytesOut"`
+}
+
+// Stats returns the current counters.
+func (l *Limits) Stats() LimitsStats {
+	return LimitsStats{
+		ActiveConns:   l.activeConns.Load(),
+		RejectedConns: l.rejectedConns.Load(),
+		BytesIn:       l.bytesIn.Load(),
+		BytesOut:      l.bytesOut.Load(),
+	}
+}
+
+// WrapIngress wraps r (bytes read from the client) with the ingress
+// bandwidth cap and byte counter.
+func (l *Limits) WrapIngress(r io.Reader) io.Reader {
+	return l.wrap(r, l.cfg.MaxBytesPerSecondIn, &l.bytesIn)
+}
+
+// WrapEgress wraps r (bytes read from the backend, destined for the
+// client) with the egress bandwidth cap and byte counter.
+func (l *Limits) WrapEgress(r io.Reader) io.Reader {
+	return l.wrap(r, l.cfg.MaxBytesPerSecondOut, &l.bytesOut)
+}
+
+func (l *Limits) wrap(r io.Reader, bytesPerSecond int64, counter *atomic.Int64) io.Reader {
+	tr := &throttledReader{r: r, counter: counter}
+	if bytesPerSecond > 0 {
+		tr.bucket = newTokenBucket(float64(bytesPerSecond), int(bytesPerSecond))
+	}
+	return tr
+}
+
+// throttledReader wraps an io.Reader, blocking Read until the configured
+// byte-per-second budget allows it, and accumulates bytes read into
+// counter for admin reporting.
+type throttledReader struct {
+	r       io.Reader
+	bucket  *tokenBucket
+	counter *atomic.Int64
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if tr.bucket != nil {
+		if cap := int(tr.bucket.capacity); len(p) > cap {
+			p = p[:cap]
+		}
+		tr.bucket.WaitN(len(p))
+	}
+	n, err := tr.r.Read(p)
+	if n > 0 {
+		tr.counter.Add(int64(n))
+	}
+	return n, err
+}
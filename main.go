@@ -1,147 +1,395 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
-	"math/rand"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
+// logger emits structured JSON logs for the proxy's operational events.
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// BackendConfig describes a single upstream server: the relative weight it
+// should receive from strategies that support it, and, when scheme is
+// "tls", how the proxy should re-encrypt its connection to it.
+type BackendConfig struct {
+	Address           string `json:"address"`
+	Weight            int    `json:"weight"`
+	Scheme            string `json:"scheme"`
+	ServerName        string `json:"serverName"`
+	CAFile            string `json:"caFile"`
+	SendProxyProtocol string `json:"sendProxyProtocol"`
+}
+
 type Config struct {
-	ListenAddr        string   `json:"listenAddr"`
-	Server            []string `json:"server"`
-	ConnectionTimeout int      `json:"connectionTimeout"`
+	ListenAddr          string            `json:"listenAddr"`
+	AdminAddr           string            `json:"adminAddr"`
+	Strategy            string            `json:"strategy"`
+	Backends            []BackendConfig   `json:"backends"`
+	HealthCheck         HealthCheckConfig `json:"healthCheck"`
+	TLS                 TLSConfig         `json:"tls"`
+	AcceptProxyProtocol bool              `json:"acceptProxyProtocol"`
+	Limits              LimitsConfig      `json:"limits"`
+	ShutdownGracePeriod int               `json:"shutdownGracePeriod"`
 }
 
 var (
-	DefaultListenAddr        = "localhost:8080"
-	DefaultServers           = [...]string{"localhost:5001", "localhost:5002", "localhost:5003"}
-	DefaultConnectionTimeout = 60
-	ConfigFile               = "config.json"
+	DefaultListenAddr = "localhost:8080"
+	DefaultAdminAddr  = "localhost:9090"
+	DefaultBackends   = [...]BackendConfig{
+		{Address: "localhost:5001", Weight: 1},
+		{Address: "localhost:5002", Weight: 1},
+		{Address: "localhost:5003", Weight: 1},
+	}
+	DefaultStrategy            = StrategyRandom
+	DefaultShutdownGracePeriod = 30
+	ConfigFile                 = "config.json"
 )
 
 func main() {
 	// Load configuration from the JSON file
 	config, err := loadConfig(ConfigFile)
 	if err != nil {
-		log.Fatalf("failed to load configuration: %s", err)
+		logger.Error("failed to load configuration", "error", err)
+		os.Exit(1)
 	}
 
-	// Create a TCP listener on the specified address or use the default
-	listener, err := net.Listen("tcp", config.ListenAddr)
+	metrics := NewMetrics()
+
+	rt, err := newRuntime(config, metrics)
 	if err != nil {
-		log.Fatalf("failed to listen: %s", err)
+		logger.Error("failed to initialize", "error", err)
+		os.Exit(1)
 	}
-	defer listener.Close()
 
-	// Notify the user that the server is listening
-	fmt.Printf("Proxy server is listening on %s\n", config.ListenAddr)
+	// current holds the live Runtime generation; a config reload swaps it
+	// in atomically so every subsequent Accept uses the new backends,
+	// strategy, and limits without dropping connections already in flight.
+	var current atomic.Pointer[Runtime]
+	current.Store(rt)
+
+	adminServer := &http.Server{Addr: config.AdminAddr, Handler: newAdminMux(&current, metrics)}
+	go func() {
+		if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("admin server stopped", "error", err)
+		}
+	}()
+	defer adminServer.Close()
+
+	// ctx is canceled on SIGINT/SIGTERM and stops every accept loop from
+	// taking new connections. forceCtx is a separate, later context: it's
+	// only canceled once the shutdown grace period elapses, so in-flight
+	// proxy() goroutines get a chance to finish naturally before being
+	// closed out from under their clients.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	forceCtx, forceCancel := context.WithCancel(context.Background())
+	defer forceCancel()
 
-	// Set up signal handling for graceful shutdown
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		logger.Info("shutdown signal received, no longer accepting new connections")
+		cancel()
+	}()
 
-	// Use a WaitGroup to wait for all goroutines to finish
+	// Use a WaitGroup to wait for all in-flight connections to drain.
 	var wg sync.WaitGroup
-	defer wg.Wait()
+
+	listener, err := newListener(config)
+	if err != nil {
+		logger.Error("failed to listen", "addr", config.ListenAddr, "error", err)
+		os.Exit(1)
+	}
+	logger.Info("proxy server listening", "addr", config.ListenAddr)
+
+	var ls listenerState
+	ls.add(startAcceptLoop(ctx, forceCtx, listener, &wg, &current, metrics))
+
+	reloader := &reloader{
+		configFile: ConfigFile,
+		current:    &current,
+		metrics:    metrics,
+		onListenAddrChange: func(addr string) {
+			newListener, err := newListener(current.Load().config)
+			if err != nil {
+				logger.Error("failed to listen on new address, keeping current listener", "addr", addr, "error", err)
+				return
+			}
+			oldStop, oldDone := ls.latest()
+			ls.add(startAcceptLoop(ctx, forceCtx, newListener, &wg, &current, metrics))
+			logger.Info("proxy server now listening", "addr", addr)
+
+			// Retire the old listener after its grace period, or
+			// immediately if shutdown begins first: otherwise it would
+			// keep accepting brand-new connections for the rest of that
+			// grace period even after "no longer accepting" has been
+			// logged.
+			gracePeriod := time.Duration(current.Load().config.ShutdownGracePeriod) * time.Second
+			go func() {
+				select {
+				case <-time.After(gracePeriod):
+				case <-ctx.Done():
+				}
+				oldStop()
+				<-oldDone
+				ls.remove(oldDone)
+			}()
+		},
+	}
+	go reloader.run(ctx)
 
 	// Notify the user that the server is ready to accept connections
-	fmt.Println("Proxy server is ready to accept connections.")
+	logger.Info("proxy server ready to accept connections")
+
+	<-ctx.Done()
+	ls.stopAndWait()
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	gracePeriod := time.Duration(current.Load().config.ShutdownGracePeriod) * time.Second
+	select {
+	case <-drained:
+		logger.Info("all connections drained, shutting down")
+	case <-time.After(gracePeriod):
+		logger.Warn("shutdown grace period exceeded, forcing remaining connections closed")
+		forceCancel()
+		<-drained
+	}
+}
+
+// newListener opens the proxy's client-facing listener for config,
+// terminating TLS on it when a certificate/key pair is configured.
+func newListener(config *Config) (net.Listener, error) {
+	if config.TLS.Enabled() {
+		tlsConfig, err := config.TLS.Build()
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure TLS: %w", err)
+		}
+		return tls.Listen("tcp", config.ListenAddr, tlsConfig)
+	}
+	return net.Listen("tcp", config.ListenAddr)
+}
+
+// startAcceptLoop runs listener's accept loop in its own goroutine, using
+// a child of ctx so it can be retired independently (e.g. when a reload
+// changes ListenAddr) without affecting other listener generations. forceCtx
+// is passed through to every connection handled by this loop and is
+// distinct from ctx: ctx stops the loop from accepting further connections,
+// while forceCtx is only canceled once the shutdown grace period elapses,
+// so in-flight connections get a chance to finish naturally first. It
+// returns a stop function and a channel closed once the loop has exited.
+func startAcceptLoop(ctx, forceCtx context.Context, listener net.Listener, wg *sync.WaitGroup, current *atomic.Pointer[Runtime], metrics *Metrics) (stop func(), done <-chan struct{}) {
+	loopCtx, cancel := context.WithCancel(ctx)
+	doneCh := make(chan struct{})
 
-	// Set a timer for connection timeout
-	timeoutTimer := time.NewTimer(time.Second * time.Duration(config.ConnectionTimeout))
-	defer timeoutTimer.Stop()
+	go func() {
+		defer close(doneCh)
+		acceptLoop(loopCtx, forceCtx, listener, wg, current, metrics)
+	}()
 
-	// Accept incoming connections and handle them
+	return func() {
+		cancel()
+		listener.Close()
+	}, doneCh
+}
+
+// acceptLoop accepts connections from listener until ctx is canceled or
+// Accept fails, handling each one using the Runtime current holds at the
+// time it was accepted. forceCtx is threaded through to proxy(); see
+// startAcceptLoop.
+func acceptLoop(ctx, forceCtx context.Context, listener net.Listener, wg *sync.WaitGroup, current *atomic.Pointer[Runtime], metrics *Metrics) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Printf("failed to accept connection: %s", err)
-			continue
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				logger.Error("failed to accept connection", "error", err)
+				continue
+			}
 		}
 
-		// Choose a backend server randomly
-		backend := chooseBackend(config.Server)
+		rt := current.Load()
 
-		// Increment the WaitGroup counter and notify the user about handling a new connection
+		// Hand off to a per-connection goroutine immediately: parsing the
+		// PROXY protocol header and picking a backend both do I/O or
+		// blocking work that must not stall this loop's next Accept.
 		wg.Add(1)
-		fmt.Printf("Handling connection from %s. Proxying to backend: %s\n", conn.RemoteAddr(), backend)
 		go func() {
 			defer wg.Done()
-			err := proxy(backend, conn)
-			if err != nil {
-				log.Printf("failed to proxy: %s", err)
-			}
+			handleConn(forceCtx, conn, rt, metrics)
 		}()
+	}
+}
 
-		// Reset the timer since a new connection is accepted
-		timeoutTimer.Reset(time.Second * time.Duration(config.ConnectionTimeout))
+// handleConn parses an optional PROXY protocol header, admits conn under
+// rt's limits, picks a backend, and proxies traffic to it. It runs in its
+// own goroutine per connection so a slow or stalled client can never block
+// acceptLoop's Accept. forceCtx is passed to proxy() to force-close the
+// connection if shutdown's grace period elapses before it finishes.
+func handleConn(forceCtx context.Context, conn net.Conn, rt *Runtime, metrics *Metrics) {
+	if rt.config.AcceptProxyProtocol {
+		conn.SetReadDeadline(time.Now().Add(proxyProtocolReadTimeout))
+		wrapped, err := acceptProxyProtocol(conn)
+		if err != nil {
+			logger.Error("failed to parse PROXY protocol header", "error", err)
+			return
+		}
+		conn = wrapped
+		conn.SetReadDeadline(time.Time{})
 	}
 
-	// Wait for the termination signal or timeout
-	select {
-	case <-sig:
-		log.Println("Shutting down...")
-		return
-	case <-timeoutTimer.C:
-		log.Println("Connection timeout reached. Shutting down...")
+	if !rt.limits.Admit(conn) {
+		logger.Warn("rejecting connection: limit exceeded", "client_addr", conn.RemoteAddr().String())
+		conn.Close()
 		return
 	}
+	defer rt.limits.Release(conn)
+
+	// Choose a backend server using the configured strategy
+	backend := rt.balancer.Pick(conn)
+	defer rt.balancer.Release(backend)
+
+	logger.Info("handling connection", "client_addr", conn.RemoteAddr().String(), "backend", backend.Address)
+	if err := proxy(forceCtx, backend, conn, rt.limits, metrics); err != nil {
+		logger.Error("failed to proxy", "backend", backend.Address, "error", err)
+	}
 }
 
-// proxy handles the proxying of data between the client and the backend server
-func proxy(backend string, c net.Conn) error {
+// newBackends converts the configured backend entries into the Backend
+// instances the load-balancing strategies operate on.
+func newBackends(configs []BackendConfig) ([]*Backend, error) {
+	backends := make([]*Backend, len(configs))
+	for i, c := range configs {
+		backend, err := NewBackend(c)
+		if err != nil {
+			return nil, err
+		}
+		backends[i] = backend
+	}
+	return backends, nil
+}
+
+// proxy handles the proxying of data between the client and the backend
+// server. ctx is the shutdown force-close context, not the accept loop's
+// stop context: it's only canceled once the shutdown grace period has
+// elapsed, so this connection is closed immediately on ctx.Done() only
+// after it's had that long to finish on its own.
+func proxy(ctx context.Context, backend *Backend, c net.Conn, limits *Limits, metrics *Metrics) error {
 	defer c.Close()
 
-	// Connect to the chosen backend server with a timeout
-	bc, err := net.DialTimeout("tcp", backend, time.Second*5)
+	start := time.Now()
+	metrics.IncActiveConnections(backend.Address)
+	defer metrics.DecActiveConnections(backend.Address)
+
+	// Connect to the chosen backend server with a timeout, re-encrypting
+	// with TLS if it declares scheme "tls".
+	dialStart := time.Now()
+	bc, err := dialBackend(backend)
 	if err != nil {
-		return fmt.Errorf("failed to connect to backend %s: %v", backend, err)
+		backend.RecordFailure()
+		metrics.SetBackendUp(backend.Address, backend.Healthy())
+		metrics.RecordDialFailure(backend.Address)
+		metrics.RecordConnection(backend.Address, "dial_error")
+		return fmt.Errorf("failed to connect to backend %s: %v", backend.Address, err)
 	}
 	defer bc.Close()
+	backend.RecordSuccess()
+	metrics.SetBackendUp(backend.Address, backend.Healthy())
+	metrics.ObserveConnectDuration(backend.Address, time.Since(dialStart).Seconds())
+
+	if backend.SendProxyProtocol != "" {
+		if err := writeProxyProtocolHeader(bc, backend.SendProxyProtocol, c.RemoteAddr(), bc.LocalAddr()); err != nil {
+			metrics.RecordConnection(backend.Address, "error")
+			return fmt.Errorf("failed to send PROXY protocol header to backend %s: %v", backend.Address, err)
+		}
+	}
+
+	// Close both legs as soon as ctx is canceled, to drain this connection
+	// without waiting on the copy loops below to notice on their own.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+			bc.Close()
+		case <-stop:
+		}
+	}()
 
 	// Use a WaitGroup to wait for both copy operations to finish
 	var wg sync.WaitGroup
 	wg.Add(2)
 
-	// Copy data from client to backend
+	var bytesIn, bytesOut int64
+	var copyFailed atomic.Bool
+
+	// Copy data from client to backend, subject to the ingress bandwidth cap
 	go func() {
 		defer wg.Done()
-		_, err := io.Copy(bc, c)
+		n, err := io.Copy(bc, limits.WrapIngress(c))
+		bytesIn = n
 		if err != nil {
-			log.Printf("failed to copy from client to backend: %s", err)
+			logger.Error("failed to copy from client to backend", "backend", backend.Address, "error", err)
+			backend.RecordFailure()
+			metrics.SetBackendUp(backend.Address, backend.Healthy())
+			copyFailed.Store(true)
 		}
 	}()
 
-	// Copy data from backend to client
+	// Copy data from backend to client, subject to the egress bandwidth cap
 	go func() {
 		defer wg.Done()
-		_, err := io.Copy(c, bc)
+		n, err := io.Copy(c, limits.WrapEgress(bc))
+		bytesOut = n
 		if err != nil {
-			log.Printf("failed to copy from backend to client: %s", err)
+			logger.Error("failed to copy from backend to client", "backend", backend.Address, "error", err)
+			backend.RecordFailure()
+			metrics.SetBackendUp(backend.Address, backend.Healthy())
+			copyFailed.Store(true)
 		}
 	}()
 
 	// Wait for both copy operations to finish
 	wg.Wait()
 
-	// Notify the user that the connection has been closed
-	fmt.Printf("Connection from %s closed. Proxying to %s terminated.\n", c.RemoteAddr(), backend)
+	metrics.AddBytes("in", backend.Address, bytesIn)
+	metrics.AddBytes("out", backend.Address, bytesOut)
 
-	return nil
-}
+	result := "success"
+	if copyFailed.Load() {
+		result = "error"
+	}
+	metrics.RecordConnection(backend.Address, result)
 
-// chooseBackend selects a backend server randomly
-func chooseBackend(servers []string) string {
-	rand.Seed(time.Now().UnixNano())
-	return servers[rand.Intn(len(servers))]
+	logger.Info("connection closed",
+		"client_addr", c.RemoteAddr().String(),
+		"backend", backend.Address,
+		"bytes_in", bytesIn,
+		"bytes_out", bytesOut,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	return nil
 }
 
 // loadConfig loads configuration from a JSON file or uses defaults
@@ -150,18 +398,24 @@ func loadConfig(filename string) (*Config, error) {
 	if err != nil {
 		// Use default values if the file is not present
 		return &Config{
-			ListenAddr:        DefaultListenAddr,
-			Server:            append([]string{}, DefaultServers[:]...),
-			ConnectionTimeout: DefaultConnectionTimeout,
+			ListenAddr:          DefaultListenAddr,
+			AdminAddr:           DefaultAdminAddr,
+			Strategy:            DefaultStrategy,
+			Backends:            append([]BackendConfig{}, DefaultBackends[:]...),
+			HealthCheck:         DefaultHealthCheck,
+			ShutdownGracePeriod: DefaultShutdownGracePeriod,
 		}, nil
 	}
 	defer file.Close()
 
 	decoder := json.NewDecoder(file)
 	config := &Config{
-		ListenAddr:        DefaultListenAddr,
-		Server:            append([]string{}, DefaultServers[:]...),
-		ConnectionTimeout: DefaultConnectionTimeout,
+		ListenAddr:          DefaultListenAddr,
+		AdminAddr:           DefaultAdminAddr,
+		Strategy:            DefaultStrategy,
+		Backends:            append([]BackendConfig{}, DefaultBackends[:]...),
+		HealthCheck:         DefaultHealthCheck,
+		ShutdownGracePeriod: DefaultShutdownGracePeriod,
 	}
 
 	err = decoder.Decode(config)
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the Prometheus collectors the proxy reports through the
+// admin server's /metrics endpoint. It is constructed once in main and
+// threaded through the proxy hot path and the health checker, independent
+// of config reloads, so counters persist across Runtime generations.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	connectionsTotal       *prometheus.CounterVec
+	activeConnections      *prometheus.GaugeVec
+	bytesTotal             *prometheus.CounterVec
+	backendUp              *prometheus.GaugeVec
+	connectDurationSeconds *prometheus.HistogramVec
+	dialFailuresTotal      *prometheus.CounterVec
+}
+
+// NewMetrics builds a Metrics on its own registry, so registration can't
+// collide with other prometheus users linked into the binary.
+func NewMetrics() *Metrics {
+	registry := prometheus.NewRegistry()
+
+	m := &Metrics{
+		registry: registry,
+		connectionsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lb_connections_total",
+			Help: "Total proxied connections, by backend and result.",
+		}, []string{"backend", "result"}),
+		activeConnections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "lb_active_connections",
+			Help: "Connections currently being proxied, by backend.",
+		}, []string{"backend"}),
+		bytesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lb_bytes_total",
+			Help: "Total bytes proxied, by direction (in/out) and backend.",
+		}, []string{"direction", "backend"}),
+		backendUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "lb_backend_up",
+			Help: "Whether a backend is currently considered healthy (1) or not (0).",
+		}, []string{"backend"}),
+		connectDurationSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "lb_connect_duration_seconds",
+			Help:    "Time to establish a connection to a backend.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"backend"}),
+		dialFailuresTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lb_upstream_dial_failures_total",
+			Help: "Total failed attempts to dial a backend, by backend.",
+		}, []string{"backend"}),
+	}
+
+	registry.MustRegister(
+		m.connectionsTotal,
+		m.activeConnections,
+		m.bytesTotal,
+		m.backendUp,
+		m.connectDurationSeconds,
+		m.dialFailuresTotal,
+	)
+	return m
+}
+
+// Handler returns the HTTP handler to mount at /metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RecordConnection counts one proxied connection to backend finishing with
+// result (e.g. "success", "dial_error").
+func (m *Metrics) RecordConnection(backend, result string) {
+	m.connectionsTotal.WithLabelValues(backend, result).Inc()
+}
+
+// IncActiveConnections marks one more connection as being proxied to backend.
+func (m *Metrics) IncActiveConnections(backend string) {
+	m.activeConnections.WithLabelValues(backend).Inc()
+}
+
+// DecActiveConnections marks one fewer connection as being proxied to backend.
+func (m *Metrics) DecActiveConnections(backend string) {
+	m.activeConnections.WithLabelValues(backend).Dec()
+}
+
+// AddBytes accounts n additional bytes proxied in direction ("in" or "out")
+// for backend.
+func (m *Metrics) AddBytes(direction, backend string, n int64) {
+	if n <= 0 {
+		return
+	}
+	m.bytesTotal.WithLabelValues(direction, backend).Add(float64(n))
+}
+
+// SetBackendUp records backend's current health state.
+func (m *Metrics) SetBackendUp(backend string, up bool) {
+	v := 0.0
+	if up {
+		v = 1.0
+	}
+	m.backendUp.WithLabelValues(backend).Set(v)
+}
+
+// ObserveConnectDuration records how long it took to establish a connection
+// to backend.
+func (m *Metrics) ObserveConnectDuration(backend string, seconds float64) {
+	m.connectDurationSeconds.WithLabelValues(backend).Observe(seconds)
+}
+
+// RecordDialFailure counts one failed dial attempt to backend.
+func (m *Metrics) RecordDialFailure(backend string) {
+	m.dialFailuresTotal.WithLabelValues(backend).Inc()
+}
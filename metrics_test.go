@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics_RecordConnection(t *testing.T) {
+	m := NewMetrics()
+	m.RecordConnection("backend1", "success")
+	m.RecordConnection("backend1", "success")
+	m.RecordConnection("backend1", "dial_error")
+
+	if got := testutil.ToFloat64(m.connectionsTotal.WithLabelValues("backend1", "success")); got != 2 {
+		t.Errorf("success count = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.connectionsTotal.WithLabelValues("backend1", "dial_error")); got != 1 {
+		t.Errorf("dial_error count = %v, want 1", got)
+	}
+}
+
+func TestMetrics_ActiveConnections(t *testing.T) {
+	m := NewMetrics()
+	m.IncActiveConnections("backend1")
+	m.IncActiveConnections("backend1")
+	m.DecActiveConnections("backend1")
+
+	if got := testutil.ToFloat64(m.activeConnections.WithLabelValues("backend1")); got != 1 {
+		t.Errorf("active connections = %v, want 1", got)
+	}
+}
+
+func TestMetrics_AddBytes(t *testing.T) {
+	m := NewMetrics()
+	m.AddBytes("in", "backend1", 100)
+	m.AddBytes("in", "backend1", 50)
+	m.AddBytes("in", "backend1", 0)  // no-op
+	m.AddBytes("in", "backend1", -5) // no-op, guards against a negative read count
+
+	if got := testutil.ToFloat64(m.bytesTotal.WithLabelValues("in", "backend1")); got != 150 {
+		t.Errorf("bytes in = %v, want 150 (the zero/negative calls should be no-ops)", got)
+	}
+}
+
+func TestMetrics_SetBackendUp(t *testing.T) {
+	m := NewMetrics()
+	m.SetBackendUp("backend1", true)
+	if got := testutil.ToFloat64(m.backendUp.WithLabelValues("backend1")); got != 1 {
+		t.Errorf("backendUp = %v, want 1", got)
+	}
+
+	m.SetBackendUp("backend1", false)
+	if got := testutil.ToFloat64(m.backendUp.WithLabelValues("backend1")); got != 0 {
+		t.Errorf("backendUp = %v, want 0", got)
+	}
+}
+
+func TestMetrics_RecordDialFailure(t *testing.T) {
+	m := NewMetrics()
+	m.RecordDialFailure("backend1")
+	m.RecordDialFailure("backend1")
+
+	if got := testutil.ToFloat64(m.dialFailuresTotal.WithLabelValues("backend1")); got != 2 {
+		t.Errorf("dial failures = %v, want 2", got)
+	}
+}
+
+func TestMetrics_HandlerServesRegisteredMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.RecordConnection("backend1", "success")
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "lb_connections_total") {
+		t.Errorf("response body missing lb_connections_total metric:\n%s", body)
+	}
+}
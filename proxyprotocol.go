@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// proxyProtocolV2Signature is the fixed 12-byte prefix of every PROXY
+// protocol v2 header.
+const proxyProtocolV2Signature = "\x0D\x0A\x0D\x0A\x00\x0D\x0A\x51\x55\x49\x54\x0A"
+
+// proxyProtocolReadTimeout bounds how long acceptProxyProtocol will wait for
+// a client to send its header, so a connection that sends nothing (or
+// trickles bytes) can't tie up its handler goroutine indefinitely.
+const proxyProtocolReadTimeout = 5 * time.Second
+
+// ProxyProtocolInfo carries the original client/destination address pair
+// recovered from an inbound PROXY protocol header.
+type ProxyProtocolInfo struct {
+	SrcAddr string
+	DstAddr string
+}
+
+// bufferedConn is a net.Conn that serves reads from a bufio.Reader wrapping
+// the same underlying connection, so bytes already buffered while parsing a
+// PROXY protocol header are replayed before new data arrives.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func newBufferedConn(c net.Conn, r *bufio.Reader) *bufferedConn {
+	return &bufferedConn{Conn: c, r: r}
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+// proxyProtocolConn overrides RemoteAddr with the client address recovered
+// from a PROXY protocol header, so balancer strategies and logging see the
+// real client rather than the trusted upstream that terminated TCP.
+type proxyProtocolConn struct {
+	net.Conn
+	remoteAddr net.Addr
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// acceptProxyProtocol parses an inbound PROXY protocol header from conn and
+// returns a conn whose RemoteAddr reflects the real client when the header
+// carried one. conn is closed if parsing fails.
+func acceptProxyProtocol(conn net.Conn) (net.Conn, error) {
+	info, wrapped, err := readProxyProtocolHeader(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if info == nil || info.SrcAddr == "" {
+		return wrapped, nil
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", info.SrcAddr)
+	if err != nil {
+		return wrapped, nil
+	}
+	return &proxyProtocolConn{Conn: wrapped, remoteAddr: addr}, nil
+}
+
+// readProxyProtocolHeader detects and parses a PROXY protocol v1 or v2
+// header from the front of conn. It returns the parsed info (nil if conn
+// didn't start with one) and a conn to use afterwards, which replays any
+// bytes read past the header before the rest of the stream.
+func readProxyProtocolHeader(conn net.Conn) (*ProxyProtocolInfo, net.Conn, error) {
+	br := bufio.NewReader(conn)
+
+	if sig, err := br.Peek(len(proxyProtocolV2Signature)); err == nil && string(sig) == proxyProtocolV2Signature {
+		info, err := parseProxyProtocolV2(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return info, newBufferedConn(conn, br), nil
+	}
+
+	if sig, err := br.Peek(5); err == nil && string(sig) == "PROXY" {
+		info, err := parseProxyProtocolV1(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return info, newBufferedConn(conn, br), nil
+	}
+
+	return nil, newBufferedConn(conn, br), nil
+}
+
+// parseProxyProtocolV1 parses the ASCII header line, e.g.
+// "PROXY TCP4 src dst sport dport\r\n" or "PROXY UNKNOWN\r\n".
+func parseProxyProtocolV1(br *bufio.Reader) (*ProxyProtocolInfo, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PROXY v1 header: %w", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, fmt.Errorf("malformed PROXY v1 header: %q", line)
+	}
+	if fields[1] == "UNKNOWN" {
+		return &ProxyProtocolInfo{}, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("malformed PROXY v1 header: %q", line)
+	}
+
+	return &ProxyProtocolInfo{
+		SrcAddr: net.JoinHostPort(fields[2], fields[4]),
+		DstAddr: net.JoinHostPort(fields[3], fields[5]),
+	}, nil
+}
+
+// parseProxyProtocolV2 parses the binary header: the 12-byte signature,
+// version/command byte, address family/protocol byte, a 16-bit body
+// length, then the body itself.
+func parseProxyProtocolV2(br *bufio.Reader) (*ProxyProtocolInfo, error) {
+	sig := make([]byte, len(proxyProtocolV2Signature))
+	if _, err := io.ReadFull(br, sig); err != nil {
+		return nil, fmt.Errorf("failed to read PROXY v2 signature: %w", err)
+	}
+
+	verCmd, err := br.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PROXY v2 version/command byte: %w", err)
+	}
+	famProto, err := br.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PROXY v2 family/protocol byte: %w", err)
+	}
+
+	var length uint16
+	if err := binary.Read(br, binary.BigEndian, &length); err != nil {
+		return nil, fmt.Errorf("failed to read PROXY v2 length: %w", err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(br, body); err != nil {
+		return nil, fmt.Errorf("failed to read PROXY v2 body: %w", err)
+	}
+
+	if version := verCmd >> 4; version != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", version)
+	}
+	if command := verCmd & 0x0F; command == 0x0 {
+		// LOCAL command: health check or other connection from the proxy
+		// infrastructure itself, carrying no real client address.
+		return &ProxyProtocolInfo{}, nil
+	}
+
+	switch family := famProto >> 4; family {
+	case 0x1: // AF_INET
+		if len(body) < 12 {
+			return nil, fmt.Errorf("PROXY v2 body too short for IPv4 addresses")
+		}
+		return &ProxyProtocolInfo{
+			SrcAddr: net.JoinHostPort(net.IP(body[0:4]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(body[8:10])))),
+			DstAddr: net.JoinHostPort(net.IP(body[4:8]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(body[10:12])))),
+		}, nil
+	case 0x2: // AF_INET6
+		if len(body) < 36 {
+			return nil, fmt.Errorf("PROXY v2 body too short for IPv6 addresses")
+		}
+		return &ProxyProtocolInfo{
+			SrcAddr: net.JoinHostPort(net.IP(body[0:16]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(body[32:34])))),
+			DstAddr: net.JoinHostPort(net.IP(body[16:32]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(body[34:36])))),
+		}, nil
+	default:
+		// AF_UNIX or unspecified; no usable address pair.
+		return &ProxyProtocolInfo{}, nil
+	}
+}
+
+// writeProxyProtocolHeader writes a PROXY protocol header describing
+// clientAddr/backendAddr onto bc in the requested version ("v1" or "v2"),
+// before any proxied application data.
+func writeProxyProtocolHeader(bc net.Conn, version string, clientAddr, backendAddr net.Addr) error {
+	switch version {
+	case "v1":
+		return writeProxyProtocolV1(bc, clientAddr, backendAddr)
+	case "v2":
+		return writeProxyProtocolV2(bc, clientAddr, backendAddr)
+	default:
+		return fmt.Errorf("unknown sendProxyProtocol version %q", version)
+	}
+}
+
+func writeProxyProtocolV1(bc net.Conn, clientAddr, backendAddr net.Addr) error {
+	clientTCP, ok1 := clientAddr.(*net.TCPAddr)
+	backendTCP, ok2 := backendAddr.(*net.TCPAddr)
+	if !ok1 || !ok2 {
+		_, err := fmt.Fprintf(bc, "PROXY UNKNOWN\r\n")
+		return err
+	}
+
+	family := "TCP4"
+	if clientTCP.IP.To4() == nil {
+		family = "TCP6"
+	}
+	_, err := fmt.Fprintf(bc, "PROXY %s %s %s %d %d\r\n",
+		family, clientTCP.IP.String(), backendTCP.IP.String(), clientTCP.Port, backendTCP.Port)
+	return err
+}
+
+func writeProxyProtocolV2(bc net.Conn, clientAddr, backendAddr net.Addr) error {
+	clientTCP, ok1 := clientAddr.(*net.TCPAddr)
+	backendTCP, ok2 := backendAddr.(*net.TCPAddr)
+	if !ok1 || !ok2 {
+		_, err := bc.Write(append([]byte(proxyProtocolV2Signature), 0x20, 0x00, 0x00, 0x00))
+		return err
+	}
+
+	var famProto byte
+	var body []byte
+	if ip4 := clientTCP.IP.To4(); ip4 != nil {
+		famProto = 0x11 // AF_INET, STREAM
+		body = append(body, ip4...)
+		body = append(body, backendTCP.IP.To4()...)
+	} else {
+		famProto = 0x21 // AF_INET6, STREAM
+		body = append(body, clientTCP.IP.To16()...)
+		body = append(body, backendTCP.IP.To16()...)
+	}
+
+	ports := make([]byte, 4)
+	binary.BigEndian.PutUint16(ports[0:2], uint16(clientTCP.Port))
+	binary.BigEndian.PutUint16(ports[2:4], uint16(backendTCP.Port))
+	body = append(body, ports...)
+
+	header := append([]byte(proxyProtocolV2Signature), 0x21, famProto)
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(body)))
+	header = append(header, length...)
+	header = append(header, body...)
+
+	_, err := bc.Write(header)
+	return err
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseProxyProtocolV1(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    *ProxyProtocolInfo
+		wantErr bool
+	}{
+		{
+			name: "tcp4",
+			line: "PROXY TCP4 192.168.1.1 192.168.1.2 56324 443\r\n",
+			want: &ProxyProtocolInfo{SrcAddr: "192.168.1.1:56324", DstAddr: "192.168.1.2:443"},
+		},
+		{
+			name: "tcp6",
+			line: "PROXY TCP6 ::1 ::2 56324 443\r\n",
+			want: &ProxyProtocolInfo{SrcAddr: "[::1]:56324", DstAddr: "[::2]:443"},
+		},
+		{
+			name: "unknown",
+			line: "PROXY UNKNOWN\r\n",
+			want: &ProxyProtocolInfo{},
+		},
+		{
+			name:    "wrong keyword",
+			line:    "HELLO TCP4 1.1.1.1 2.2.2.2 1 2\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "too few fields",
+			line:    "PROXY TCP4 1.1.1.1\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "truncated, no newline",
+			line:    "PROXY TCP4 1.1.1.1 2.2.2.2 1 2",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := bufio.NewReader(strings.NewReader(tt.line))
+			got, err := parseProxyProtocolV1(br)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseProxyProtocolV1(%q) = %+v, want error", tt.line, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseProxyProtocolV1(%q) unexpected error: %v", tt.line, err)
+			}
+			if *got != *tt.want {
+				t.Errorf("parseProxyProtocolV1(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProxyProtocolV2(t *testing.T) {
+	var clientAddr net.Addr = &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 12345}
+	var backendAddr net.Addr = &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 443}
+
+	t.Run("valid ipv4 round-trips through the writer", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeProxyProtocolV2(fakeConn{Writer: &buf}, clientAddr, backendAddr); err != nil {
+			t.Fatalf("writeProxyProtocolV2: %v", err)
+		}
+
+		got, err := parseProxyProtocolV2(bufio.NewReader(&buf))
+		if err != nil {
+			t.Fatalf("parseProxyProtocolV2: %v", err)
+		}
+		want := &ProxyProtocolInfo{SrcAddr: "10.0.0.1:12345", DstAddr: "10.0.0.2:443"}
+		if *got != *want {
+			t.Errorf("parseProxyProtocolV2 = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("local command carries no address", func(t *testing.T) {
+		header := append([]byte(proxyProtocolV2Signature), 0x20, 0x00, 0x00, 0x00)
+		got, err := parseProxyProtocolV2(bufio.NewReader(bytes.NewReader(header)))
+		if err != nil {
+			t.Fatalf("parseProxyProtocolV2: %v", err)
+		}
+		if *got != (ProxyProtocolInfo{}) {
+			t.Errorf("parseProxyProtocolV2 = %+v, want empty info", got)
+		}
+	})
+
+	t.Run("unsupported version rejected", func(t *testing.T) {
+		header := append([]byte(proxyProtocolV2Signature), 0x11, 0x11, 0x00, 0x00)
+		if _, err := parseProxyProtocolV2(bufio.NewReader(bytes.NewReader(header))); err == nil {
+			t.Fatal("parseProxyProtocolV2 with version 1 in the v2 framing: want error, got nil")
+		}
+	})
+
+	t.Run("body too short for declared address family", func(t *testing.T) {
+		// famProto 0x11 = AF_INET, but the body only has 4 bytes, not the
+		// 12 an IPv4 src+dst+ports triple needs.
+		header := append([]byte(proxyProtocolV2Signature), 0x21, 0x11, 0x00, 0x04, 0x01, 0x02, 0x03, 0x04)
+		if _, err := parseProxyProtocolV2(bufio.NewReader(bytes.NewReader(header))); err == nil {
+			t.Fatal("parseProxyProtocolV2 with truncated IPv4 body: want error, got nil")
+		}
+	})
+
+	t.Run("truncated before length field", func(t *testing.T) {
+		header := append([]byte(proxyProtocolV2Signature), 0x21)
+		if _, err := parseProxyProtocolV2(bufio.NewReader(bytes.NewReader(header))); err == nil {
+			t.Fatal("parseProxyProtocolV2 with no family/protocol byte: want error, got nil")
+		}
+	})
+}
+
+func TestReadProxyProtocolHeader(t *testing.T) {
+	t.Run("no header present, bytes are replayed untouched", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+
+		go func() {
+			client.Write([]byte("GET / HTTP/1.1\r\n"))
+		}()
+
+		info, wrapped, err := readProxyProtocolHeader(server)
+		if err != nil {
+			t.Fatalf("readProxyProtocolHeader: %v", err)
+		}
+		if info != nil {
+			t.Fatalf("info = %+v, want nil for a connection with no PROXY header", info)
+		}
+
+		buf := make([]byte, 16)
+		n, err := wrapped.Read(buf)
+		if err != nil {
+			t.Fatalf("Read replayed bytes: %v", err)
+		}
+		if got := string(buf[:n]); got != "GET / HTTP/1.1\r\n" {
+			t.Errorf("replayed bytes = %q, want %q", got, "GET / HTTP/1.1\r\n")
+		}
+	})
+
+	t.Run("v1 header consumed, later bytes replayed", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+
+		go func() {
+			client.Write([]byte("PROXY TCP4 1.2.3.4 5.6.7.8 1111 443\r\nhello"))
+		}()
+
+		info, wrapped, err := readProxyProtocolHeader(server)
+		if err != nil {
+			t.Fatalf("readProxyProtocolHeader: %v", err)
+		}
+		if info == nil || info.SrcAddr != "1.2.3.4:1111" {
+			t.Fatalf("info = %+v, want SrcAddr 1.2.3.4:1111", info)
+		}
+
+		buf := make([]byte, 16)
+		n, err := wrapped.Read(buf)
+		if err != nil {
+			t.Fatalf("Read trailing bytes: %v", err)
+		}
+		if got := string(buf[:n]); got != "hello" {
+			t.Errorf("trailing bytes = %q, want %q", got, "hello")
+		}
+	})
+
+	t.Run("malformed header returns an error", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+
+		go func() {
+			client.Write([]byte("PROXY GARBAGE\r\n"))
+		}()
+
+		if _, _, err := readProxyProtocolHeader(server); err == nil {
+			t.Fatal("readProxyProtocolHeader with malformed header: want error, got nil")
+		}
+	})
+}
+
+// fakeConn adapts an io.Writer to net.Conn for tests that only exercise the
+// writer side of the PROXY protocol helpers.
+type fakeConn struct {
+	net.Conn
+	Writer interface{ Write([]byte) (int, error) }
+}
+
+func (c fakeConn) Write(p []byte) (int, error) { return c.Writer.Write(p) }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Runtime holds the set of components derived from one generation of
+// Config that can be swapped in atomically on a hot reload: the backend
+// pool, the load-balancing strategy built over it, the limits enforcer,
+// and that generation's health-check loop.
+type Runtime struct {
+	config       *Config
+	backends     []*Backend
+	balancer     Balancer
+	limits       *Limits
+	healthCancel context.CancelFunc
+}
+
+// newRuntime builds a Runtime from config and starts its health-check
+// loop. The returned error is the validation failure a caller should
+// report instead of swapping the new Runtime in. metrics is shared across
+// reloads, so counters and gauges persist across Runtime generations.
+func newRuntime(config *Config, metrics *Metrics) (*Runtime, error) {
+	backends, err := newBackends(config.Backends)
+	if err != nil {
+		return nil, fmt.Errorf("backends: %w", err)
+	}
+
+	balancer, err := NewBalancer(config.Strategy, backends)
+	if err != nil {
+		return nil, fmt.Errorf("strategy: %w", err)
+	}
+
+	healthCtx, cancel := context.WithCancel(context.Background())
+	go NewHealthChecker(config.HealthCheck, backends, metrics).Run(healthCtx)
+
+	return &Runtime{
+		config:       config,
+		backends:     backends,
+		balancer:     balancer,
+		limits:       NewLimits(config.Limits),
+		healthCancel: cancel,
+	}, nil
+}
+
+// Close stops this generation's health-check loop. Call it once the
+// Runtime has been swapped out.
+func (rt *Runtime) Close() {
+	rt.healthCancel()
+}
+
+// listenerGen is one generation of accept loop: the stop function that
+// retires it and the channel closed once it has actually exited.
+type listenerGen struct {
+	stop func()
+	done <-chan struct{}
+}
+
+// listenerState tracks every accept-loop generation that hasn't finished
+// exiting yet, so a reload that changes ListenAddr can start a new one and
+// retire the old one without a data race against the shutdown path reading
+// the same fields — and so shutdown can stop every outstanding generation,
+// not just whichever is current, if it races a reload's grace period.
+type listenerState struct {
+	mu   sync.Mutex
+	gens []listenerGen
+}
+
+// add registers a newly started generation.
+func (ls *listenerState) add(stop func(), done <-chan struct{}) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.gens = append(ls.gens, listenerGen{stop, done})
+}
+
+// latest returns the stop function and done channel for whichever accept
+// loop was most recently added.
+func (ls *listenerState) latest() (stop func(), done <-chan struct{}) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	last := ls.gens[len(ls.gens)-1]
+	return last.stop, last.done
+}
+
+// remove drops a generation once its caller has stopped and drained it, so
+// it isn't stopped and waited on again by stopAndWait.
+func (ls *listenerState) remove(done <-chan struct{}) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	for i, g := range ls.gens {
+		if g.done == done {
+			ls.gens = append(ls.gens[:i], ls.gens[i+1:]...)
+			return
+		}
+	}
+}
+
+// stopAndWait stops and waits for every generation that hasn't already been
+// removed, including ones retired by a reload but still inside their grace
+// period. stop is idempotent (cancels a context and closes a listener), so
+// it's safe even if a concurrent grace-period goroutine is also retiring it.
+func (ls *listenerState) stopAndWait() {
+	ls.mu.Lock()
+	gens := append([]listenerGen(nil), ls.gens...)
+	ls.mu.Unlock()
+
+	for _, g := range gens {
+		g.stop()
+	}
+	for _, g := range gens {
+		<-g.done
+	}
+}
+
+// reloader watches ConfigFile for SIGHUP and filesystem changes, rebuilding
+// a Runtime and atomically swapping it into current on every valid change.
+// If the reloaded ListenAddr differs from the previous one, onListenAddrChange
+// is invoked with the new address so the caller can start accepting on it.
+type reloader struct {
+	configFile         string
+	current            *atomic.Pointer[Runtime]
+	metrics            *Metrics
+	onListenAddrChange func(addr string)
+}
+
+// run watches for reload triggers until ctx is canceled.
+func (r *reloader) run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Warn("config reload: failed to start file watcher, SIGHUP reload still works", "error", err)
+	} else {
+		defer watcher.Close()
+		if err := watcher.Add(filepath.Dir(r.configFile)); err != nil {
+			logger.Warn("config reload: failed to watch file, SIGHUP reload still works", "file", r.configFile, "error", err)
+		}
+	}
+
+	var events <-chan fsnotify.Event
+	if watcher != nil {
+		events = watcher.Events
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.reload()
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if filepath.Clean(event.Name) == filepath.Clean(r.configFile) {
+				r.reload()
+			}
+		}
+	}
+}
+
+// reload re-parses configFile, validates it by fully constructing a new
+// Runtime, and swaps it in. A bad config is logged and left in place
+// rather than crashing or partially applying.
+func (r *reloader) reload() {
+	config, err := loadConfig(r.configFile)
+	if err != nil {
+		logger.Error("config reload: failed to load, keeping current config", "file", r.configFile, "error", err)
+		return
+	}
+
+	newRt, err := newRuntime(config, r.metrics)
+	if err != nil {
+		logger.Error("config reload: rejecting invalid config, keeping current config", "error", err)
+		return
+	}
+
+	old := r.current.Swap(newRt)
+	logger.Info("config reloaded", "file", r.configFile)
+
+	if old != nil {
+		if r.onListenAddrChange != nil && old.config.ListenAddr != newRt.config.ListenAddr {
+			r.onListenAddrChange(newRt.config.ListenAddr)
+		}
+		old.Close()
+	}
+}
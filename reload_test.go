@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestListenerState_StopAndWaitStopsEveryGeneration(t *testing.T) {
+	var ls listenerState
+	var stopped [2]bool
+
+	for i := range stopped {
+		i := i
+		done := make(chan struct{})
+		ls.add(func() { stopped[i] = true; close(done) }, done)
+	}
+
+	ls.stopAndWait()
+
+	for i, s := range stopped {
+		if !s {
+			t.Errorf("generation %d was never stopped", i)
+		}
+	}
+}
+
+func TestListenerState_RemoveExcludesGenerationFromStopAndWait(t *testing.T) {
+	var ls listenerState
+
+	done1 := make(chan struct{})
+	stopped1 := false
+	ls.add(func() { stopped1 = true; close(done1) }, done1)
+
+	done2 := make(chan struct{})
+	stopped2 := false
+	close(done2) // already retired by its own grace-period goroutine
+	ls.add(func() { stopped2 = true }, done2)
+	ls.remove(done2)
+
+	ls.stopAndWait()
+
+	if !stopped1 {
+		t.Error("remaining generation was not stopped")
+	}
+	if stopped2 {
+		t.Error("removed generation was stopped again by stopAndWait")
+	}
+}
+
+func TestListenerState_Latest(t *testing.T) {
+	var ls listenerState
+	done1 := make(chan struct{})
+	ls.add(func() {}, done1)
+	done2 := make(chan struct{})
+	ls.add(func() {}, done2)
+
+	_, got := ls.latest()
+	if got != done2 {
+		t.Error("latest() did not return the most recently added generation")
+	}
+}
+
+func writeConfigFile(t *testing.T, path string, config *Config) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create config file: %v", err)
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(config); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+}
+
+func baseTestConfig(listenAddr string) *Config {
+	return &Config{
+		ListenAddr: listenAddr,
+		AdminAddr:  DefaultAdminAddr,
+		Strategy:   StrategyRandom,
+		Backends:   []BackendConfig{{Address: "127.0.0.1:1", Weight: 1}},
+	}
+}
+
+func TestReloader_Reload_SwapsOnValidConfig(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, configFile, baseTestConfig("127.0.0.1:8080"))
+
+	metrics := NewMetrics()
+	rt, err := newRuntime(baseTestConfig("127.0.0.1:8080"), metrics)
+	if err != nil {
+		t.Fatalf("newRuntime: %v", err)
+	}
+	var current atomic.Pointer[Runtime]
+	current.Store(rt)
+
+	var newAddr string
+	r := &reloader{
+		configFile: configFile,
+		current:    &current,
+		metrics:    metrics,
+		onListenAddrChange: func(addr string) {
+			newAddr = addr
+		},
+	}
+
+	writeConfigFile(t, configFile, baseTestConfig("127.0.0.1:9090"))
+	r.reload()
+
+	if got := current.Load().config.ListenAddr; got != "127.0.0.1:9090" {
+		t.Errorf("current config ListenAddr = %q, want %q", got, "127.0.0.1:9090")
+	}
+	if newAddr != "127.0.0.1:9090" {
+		t.Errorf("onListenAddrChange called with %q, want %q", newAddr, "127.0.0.1:9090")
+	}
+}
+
+func TestReloader_Reload_KeepsOldConfigOnMalformedJSON(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, configFile, baseTestConfig("127.0.0.1:8080"))
+
+	metrics := NewMetrics()
+	rt, err := newRuntime(baseTestConfig("127.0.0.1:8080"), metrics)
+	if err != nil {
+		t.Fatalf("newRuntime: %v", err)
+	}
+	var current atomic.Pointer[Runtime]
+	current.Store(rt)
+
+	r := &reloader{configFile: configFile, current: &current, metrics: metrics}
+
+	if err := os.WriteFile(configFile, []byte("{not valid json"), 0o600); err != nil {
+		t.Fatalf("failed to corrupt config file: %v", err)
+	}
+	r.reload()
+
+	if got := current.Load().config.ListenAddr; got != "127.0.0.1:8080" {
+		t.Errorf("current config ListenAddr = %q after malformed reload, want the original %q", got, "127.0.0.1:8080")
+	}
+}
+
+func TestReloader_Reload_KeepsOldConfigOnInvalidStrategy(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, configFile, baseTestConfig("127.0.0.1:8080"))
+
+	metrics := NewMetrics()
+	rt, err := newRuntime(baseTestConfig("127.0.0.1:8080"), metrics)
+	if err != nil {
+		t.Fatalf("newRuntime: %v", err)
+	}
+	var current atomic.Pointer[Runtime]
+	current.Store(rt)
+
+	r := &reloader{configFile: configFile, current: &current, metrics: metrics}
+
+	bad := baseTestConfig("127.0.0.1:9090")
+	bad.Strategy = "not-a-real-strategy"
+	writeConfigFile(t, configFile, bad)
+	r.reload()
+
+	if got := current.Load().config.ListenAddr; got != "127.0.0.1:8080" {
+		t.Errorf("current config ListenAddr = %q after invalid-strategy reload, want the original %q", got, "127.0.0.1:8080")
+	}
+}
+
+// TestReloader_Reload_DoesNotFireOnListenAddrChangeWhenAddrIsUnchanged
+// guards against spuriously restarting the listener on a reload that only
+// changes, say, backend weights.
+func TestReloader_Reload_DoesNotFireOnListenAddrChangeWhenAddrIsUnchanged(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, configFile, baseTestConfig("127.0.0.1:8080"))
+
+	metrics := NewMetrics()
+	rt, err := newRuntime(baseTestConfig("127.0.0.1:8080"), metrics)
+	if err != nil {
+		t.Fatalf("newRuntime: %v", err)
+	}
+	var current atomic.Pointer[Runtime]
+	current.Store(rt)
+
+	called := false
+	r := &reloader{
+		configFile:         configFile,
+		current:            &current,
+		metrics:            metrics,
+		onListenAddrChange: func(addr string) { called = true },
+	}
+
+	writeConfigFile(t, configFile, baseTestConfig("127.0.0.1:8080"))
+	r.reload()
+
+	if called {
+		t.Error("onListenAddrChange fired for a reload that kept the same ListenAddr")
+	}
+}
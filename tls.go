@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// TLSConfig configures the proxy's client-facing listener: the
+// certificate/key pair it presents, the minimum protocol version, and an
+// optional cipher suite allowlist. Leaving CertFile/KeyFile empty keeps the
+// listener as plain TCP.
+type TLSConfig struct {
+	CertFile     string   `json:"cert"`
+	KeyFile      string   `json:"key"`
+	MinVersion   string   `json:"minTLSVersion"`
+	CipherSuites []string `json:"cipherSuites"`
+}
+
+// Enabled reports whether a certificate/key pair has been configured, i.e.
+// whether the proxy should terminate TLS on its listener.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// Build constructs the *tls.Config for the client-facing listener.
+func (c TLSConfig) Build() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	minVersion, err := tlsMinVersion(c.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	suites, err := tlsCipherSuites(c.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+		CipherSuites: suites,
+	}, nil
+}
+
+var tlsVersionsByName = map[string]uint16{
+	"":       tls.VersionTLS12,
+	"TLS1.0": tls.VersionTLS10,
+	"TLS1.1": tls.VersionTLS11,
+	"TLS1.2": tls.VersionTLS12,
+	"TLS1.3": tls.VersionTLS13,
+}
+
+func tlsMinVersion(name string) (uint16, error) {
+	v, ok := tlsVersionsByName[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown minTLSVersion %q", name)
+	}
+	return v, nil
+}
+
+var tlsCipherSuiteIDs = func() map[string]uint16 {
+	ids := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		ids[s.Name] = s.ID
+	}
+	return ids
+}()
+
+func tlsCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := tlsCipherSuiteIDs[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// backendTLSConfig builds the *tls.Config used to re-encrypt to a backend
+// declaring scheme "tls", honoring its serverName (for SNI/verification)
+// and an optional caFile. An empty caFile trusts the system root pool.
+func backendTLSConfig(c BackendConfig) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: c.ServerName}
+	if c.CAFile == "" {
+		return cfg, nil
+	}
+
+	pem, err := os.ReadFile(c.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read caFile %s: %w", c.CAFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("failed to parse caFile %s", c.CAFile)
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
+}
+
+// dialBackend connects to backend, re-encrypting with TLS when it declares
+// scheme "tls" and dialing plain TCP otherwise.
+func dialBackend(backend *Backend) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: time.Second * 5}
+	if backend.Scheme == BackendSchemeTLS {
+		return tls.DialWithDialer(dialer, "tcp", backend.Address, backend.tlsConfig)
+	}
+	return dialer.Dial("tcp", backend.Address)
+}
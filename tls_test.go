@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTLSConfig_Enabled(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  TLSConfig
+		want bool
+	}{
+		{name: "both set", cfg: TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem"}, want: true},
+		{name: "neither set", cfg: TLSConfig{}, want: false},
+		{name: "only cert", cfg: TLSConfig{CertFile: "cert.pem"}, want: false},
+		{name: "only key", cfg: TLSConfig{KeyFile: "key.pem"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.Enabled(); got != tt.want {
+				t.Errorf("Enabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTlsMinVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    uint16
+		wantErr bool
+	}{
+		{name: "empty defaults to 1.2", version: "", want: tls.VersionTLS12},
+		{name: "1.0", version: "TLS1.0", want: tls.VersionTLS10},
+		{name: "1.3", version: "TLS1.3", want: tls.VersionTLS13},
+		{name: "unknown", version: "TLS9.9", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tlsMinVersion(tt.version)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("tlsMinVersion(%q) = %v, want error", tt.version, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("tlsMinVersion(%q) unexpected error: %v", tt.version, err)
+			}
+			if got != tt.want {
+				t.Errorf("tlsMinVersion(%q) = %v, want %v", tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTlsCipherSuites(t *testing.T) {
+	t.Run("empty list returns nil (use Go defaults)", func(t *testing.T) {
+		got, err := tlsCipherSuites(nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != nil {
+			t.Errorf("got %v, want nil", got)
+		}
+	})
+
+	t.Run("known suite resolves to its ID", func(t *testing.T) {
+		name := tls.CipherSuites()[0].Name
+		got, err := tlsCipherSuites([]string{name})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 1 || got[0] != tls.CipherSuites()[0].ID {
+			t.Errorf("tlsCipherSuites([%q]) = %v, want [%v]", name, got, tls.CipherSuites()[0].ID)
+		}
+	})
+
+	t.Run("unknown suite name errors", func(t *testing.T) {
+		if _, err := tlsCipherSuites([]string{"NOT_A_REAL_SUITE"}); err == nil {
+			t.Fatal("tlsCipherSuites with an unknown name: want error, got nil")
+		}
+	})
+}
+
+func TestBackendTLSConfig(t *testing.T) {
+	t.Run("no caFile trusts the system pool", func(t *testing.T) {
+		cfg, err := backendTLSConfig(BackendConfig{ServerName: "backend.internal"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.ServerName != "backend.internal" {
+			t.Errorf("ServerName = %q, want %q", cfg.ServerName, "backend.internal")
+		}
+		if cfg.RootCAs != nil {
+			t.Errorf("RootCAs = %v, want nil (system pool)", cfg.RootCAs)
+		}
+	})
+
+	t.Run("missing caFile errors", func(t *testing.T) {
+		if _, err := backendTLSConfig(BackendConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+			t.Fatal("backendTLSConfig with a nonexistent caFile: want error, got nil")
+		}
+	})
+
+	t.Run("malformed caFile errors", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "bad.pem")
+		if err := os.WriteFile(path, []byte("not a certificate"), 0o600); err != nil {
+			t.Fatalf("failed to write test fixture: %v", err)
+		}
+		if _, err := backendTLSConfig(BackendConfig{CAFile: path}); err == nil {
+			t.Fatal("backendTLSConfig with a malformed caFile: want error, got nil")
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket is a simple token-bucket rate limiter: capacity tokens are
+// available immediately, refilling at ratePerSecond tokens per second.
+type tokenBucket struct {
+	mu         sync.Mutex
+	rate       float64
+	capacity   float64
+	tokens     float64
+	lastRefill time.Time
+}
+
+func newTokenBucket(ratePerSecond float64, capacity int) *tokenBucket {
+	return &tokenBucket{
+		rate:       ratePerSecond,
+		capacity:   float64(capacity),
+		tokens:     float64(capacity),
+		lastRefill: time.Now(),
+	}
+}
+
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	b.lastRefill = now
+	b.tokens += elapsed * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+// Allow reports whether a single token is available, consuming it if so.
+func (b *tokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// WaitN blocks until n tokens are available, then consumes them.
+func (b *tokenBucket) WaitN(n int) {
+	for {
+		b.mu.Lock()
+		b.refill()
+		if b.tokens >= float64(n) {
+			b.tokens -= float64(n)
+			b.mu.Unlock()
+			return
+		}
+		deficit := float64(n) - b.tokens
+		wait := time.Duration(deficit/b.rate*float64(time.Second)) + time.Millisecond
+		b.mu.Unlock()
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_AllowConsumesCapacityThenRejects(t *testing.T) {
+	b := newTokenBucket(1, 3)
+
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("Allow() #%d = false, want true within the initial burst of 3", i)
+		}
+	}
+	if b.Allow() {
+		t.Fatal("Allow() = true after burst exhausted, want false")
+	}
+}
+
+func TestTokenBucket_RefillsOverTime(t *testing.T) {
+	b := newTokenBucket(100, 1) // 100 tokens/sec, burst of 1
+
+	if !b.Allow() {
+		t.Fatal("Allow() = false on a fresh bucket, want true")
+	}
+	if b.Allow() {
+		t.Fatal("Allow() = true immediately after exhausting the burst, want false")
+	}
+
+	time.Sleep(20 * time.Millisecond) // ~2 tokens at 100/sec, clipped to capacity 1
+	if !b.Allow() {
+		t.Fatal("Allow() = false after waiting past the refill rate, want true")
+	}
+}
+
+func TestTokenBucket_RefillNeverExceedsCapacity(t *testing.T) {
+	b := newTokenBucket(1000, 2)
+	time.Sleep(50 * time.Millisecond) // would be 50+ tokens without the cap
+
+	count := 0
+	for b.Allow() {
+		count++
+		if count > 2 {
+			t.Fatalf("Allow() succeeded more than capacity (2) times in a row: %d", count)
+		}
+	}
+	if count != 2 {
+		t.Errorf("got %d tokens available, want exactly capacity (2)", count)
+	}
+}
+
+func TestTokenBucket_WaitNBlocksUntilTokensAvailable(t *testing.T) {
+	b := newTokenBucket(100, 1) // 1 token available now, then 100/sec
+
+	start := time.Now()
+	b.WaitN(1) // immediately available
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("WaitN(1) with a token already available took %v, want near-instant", elapsed)
+	}
+
+	start = time.Now()
+	b.WaitN(1) // bucket just drained, needs ~10ms to refill 1 token at 100/sec
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Errorf("WaitN(1) on an empty bucket returned after %v, want it to block for a refill", elapsed)
+	}
+}